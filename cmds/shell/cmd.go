@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,18 +24,39 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines"
 	v2client "github.com/taskcluster/taskcluster-worker/plugins/interactive/shellclient"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
 	// Command is the root of the shell sub-tree.
 	Command = &cobra.Command{
-		Use:   "shell <taskId> [-- command to execute]",
+		Use:   "shell <taskId>[.<endpoint>][/<runId>] [-- command to execute]",
 		Short: "Connect to the shell of a running interactive task.",
 		RunE:  Execute,
 	}
+
+	stdio bool
+
+	reconnect            bool
+	reconnectMinInterval time.Duration
+	reconnectMaxInterval time.Duration
+	reconnectMaxElapsed  time.Duration
+
+	shutdownGrace time.Duration
+
+	record      string
+	recordInput bool
 )
 
 func init() {
+	Command.Flags().BoolVar(&stdio, "stdio", false, "serve an SSH connection over stdin/stdout, bridged to the remote shell, without allocating a tty (for use as an SSH ProxyCommand, see `shell config-ssh`)")
+	Command.Flags().BoolVar(&reconnect, "reconnect", true, "automatically reconnect when the interactive session drops while the task is still running")
+	Command.Flags().DurationVar(&reconnectMinInterval, "reconnect-min-interval", 50*time.Millisecond, "initial delay before the first reconnect attempt")
+	Command.Flags().DurationVar(&reconnectMaxInterval, "reconnect-max-interval", 10*time.Second, "maximum delay between reconnect attempts")
+	Command.Flags().DurationVar(&reconnectMaxElapsed, "reconnect-max-elapsed", 0, "give up reconnecting after this much total time has elapsed (0 means never give up)")
+	Command.Flags().DurationVar(&shutdownGrace, "shutdown-grace", 3*time.Second, "time to let the remote shell flush output after forwarding an interrupt, before giving up on it")
+	Command.Flags().StringVar(&record, "record", "", "record the session to this file as an asciinema v2 cast")
+	Command.Flags().BoolVar(&recordInput, "record-input", false, "also record stdin into the --record cast (off by default, since stdin may contain passwords)")
 	root.Command.AddCommand(Command)
 }
 
@@ -43,7 +66,10 @@ func Execute(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("%s expects argument <taskId>", cmd.Name())
 	}
 
-	taskID := args[0]
+	target, err := parseShellTarget(args[0])
+	if err != nil {
+		return err
+	}
 
 	var creds *tcclient.Credentials
 	if config.Credentials != nil {
@@ -52,15 +78,173 @@ func Execute(cmd *cobra.Command, args []string) error {
 
 	q := queue.New(creds)
 
-	err := checkTask(q, taskID)
-	if err != nil {
+	if target.endpoint == "" {
+		target.endpoint, err = resolveDefaultEndpoint(q, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := checkTaskRun(q, target); err != nil {
 		return err
 	}
 
-	// At this point we know we have a valid task with interactivity.
-	sURL, err := q.GetLatestArtifact_SignedURL(taskID, "private/docker-worker/shell.html", 1*time.Minute)
+	// Best-effort: remember this task so `shell config-ssh --all-interactive`
+	// can regenerate an entry for it later.
+	rememberInteractiveTask(target.taskID)
+
+	command := []string{}
+	if len(args) > 1 {
+		command = args[1:]
+	}
+
+	// In --stdio mode we never allocate a tty: the SSH client on top of us
+	// (or whatever else speaks ProxyCommand) does its own terminal handling.
+	tty := isatty.IsTerminal(os.Stdout.Fd()) && !stdio
+
+	if stdio {
+		// serveSSHOverStdio takes ownership of stdin/stdout for the whole
+		// invocation and closes them once the SSH connection they carry
+		// ends, so a redial here would hand a fresh session a permanently
+		// closed stdioConn. OpenSSH's own ProxyCommand restart is the
+		// right layer to retry a dropped --stdio session at.
+		reconnect = false
+	}
+
+	var rec *castRecorder
+	if record != "" {
+		cols, rows := 80, 24
+		if w, h, sizeErr := terminal.GetSize(int(os.Stdout.Fd())); sizeErr == nil {
+			cols, rows = w, h
+		}
+		rec, err = newCastRecorder(record, cols, rows)
+		if err != nil {
+			return err
+		}
+		defer rec.Close()
+	}
+
+	backoff := newReconnectBackoff(reconnectMinInterval, reconnectMaxInterval, reconnectMaxElapsed)
+
+	for attempt := 1; ; attempt++ {
+		shell, err := dial(q, target, command, tty)
+		if err != nil {
+			// Only the very first dial, before any session ever connected,
+			// fails fast: a failing re-dial is exactly the transient drop
+			// --reconnect exists to ride out, so route it through the same
+			// reconnectable-error/backoff decision as a session that ended
+			// after connecting.
+			if attempt == 1 {
+				return err
+			}
+			retry, retErr := waitForReconnect(q, target, backoff, attempt, err)
+			if retry {
+				continue
+			}
+			return retErr
+		}
+
+		if stdio {
+			// --stdio speaks to a ProxyCommand, not a terminal: no raw
+			// mode, no direct pipe copy, no signal forwarding. OpenSSH
+			// itself owns the byte stream; we just need to be a real SSH
+			// server on the other end of it.
+			err = serveSSHOverStdio(&stdioConn{}, shell, rec)
+		} else {
+			// Switch terminal to raw mode
+			cleanup := func() {}
+			if tty {
+				cleanup = setupRawTerminal(shell.SetSize)
+			}
+
+			stdout := io.Writer(os.Stdout)
+			stdin := io.Reader(os.Stdin)
+			var stdoutRec, stdinRec *recordingWriter
+			if rec != nil {
+				stdoutRec = newRecordingWriter(os.Stdout, rec, "o")
+				stdout = stdoutRec
+				if recordInput {
+					stdinRec = newRecordingWriter(ioutil.Discard, rec, "i")
+					stdin = io.TeeReader(os.Stdin, stdinRec)
+				}
+			}
+
+			// Connect pipes. Each recordingWriter's flush goroutine is tied to
+			// the copy it backs, so it stops with this attempt instead of
+			// outliving it across reconnects.
+			go func() {
+				ioext.CopyAndClose(shell.StdinPipe(), stdin)
+				if stdinRec != nil {
+					stdinRec.Close()
+				}
+			}()
+			go func() {
+				io.Copy(stdout, shell.StdoutPipe())
+				if stdoutRec != nil {
+					stdoutRec.Close()
+				}
+			}()
+			go io.Copy(os.Stderr, shell.StderrPipe())
+
+			// Wait for shell to be done, forwarding signals to it and restoring
+			// the terminal (via cleanup, run exactly once, unconditionally) no
+			// matter how we leave this function.
+			err = runWithSignals(shell, cleanup, shutdownGrace, rec)
+		}
+
+		// A signal-induced shutdown is deliberate: never treat it as the
+		// kind of transient transport drop --reconnect is meant to recover
+		// from, even if the underlying error also looks network-class.
+		if isSignalShutdown(err) {
+			return err
+		}
+
+		retry, retErr := waitForReconnect(q, target, backoff, attempt, err)
+		if retry {
+			continue
+		}
+		return retErr
+	}
+}
+
+// waitForReconnect decides whether to retry after err -- which may come
+// from a failed re-dial or from a session that has just ended -- and, if
+// so, sleeps for backoff's next interval before reporting it's safe to
+// redial. It reports false when the caller should stop, in which case the
+// returned error (possibly nil, possibly wrapped) is what Execute should
+// return.
+func waitForReconnect(q *queue.Queue, target *shellTarget, backoff *reconnectBackoff, attempt int, err error) (bool, error) {
+	if err == nil || !reconnect || !isReconnectableError(err) {
+		return false, err
+	}
+
+	if taskErr := checkTaskRun(q, target); taskErr != nil {
+		return false, fmt.Errorf("not reconnecting to %s: %v", target.taskID, taskErr)
+	}
+
+	wait, ok := backoff.next()
+	if !ok {
+		return false, fmt.Errorf("giving up reconnecting to %s after %s: %v", target.taskID, reconnectMaxElapsed, err)
+	}
+	fmt.Fprintf(os.Stderr, "\x1b[2mreconnecting… attempt %d (retrying in %s)\x1b[0m\n", attempt, wait)
+	time.Sleep(wait)
+	return true, nil
+}
+
+// dial resolves the task's interactive artifact and opens a fresh shell
+// against it.
+func dial(q *queue.Queue, target *shellTarget, command []string, tty bool) (engines.Shell, error) {
+	artifactName := target.artifactName()
+
+	var sURL *url.URL
+	var err error
+	if target.runID != nil {
+		sURL, err = q.GetArtifact_SignedURL(target.taskID, strconv.FormatUint(uint64(*target.runID), 10), artifactName, 1*time.Minute)
+	} else {
+		sURL, err = q.GetLatestArtifact_SignedURL(target.taskID, artifactName, 1*time.Minute)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// client is an HTTP client that doesn't follow redirects.
@@ -72,21 +256,15 @@ func Execute(cmd *cobra.Command, args []string) error {
 
 	resp, err := client.Get(sURL.String())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	redirectURL, err := resp.Location()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var sockURL *url.URL
 	var shell engines.Shell
-	tty := isatty.IsTerminal(os.Stdout.Fd())
-
-	command := []string{}
-	if len(args) > 1 {
-		command = args[1:]
-	}
 
 	switch redirectURL.Query().Get("v") {
 	case "1":
@@ -114,40 +292,27 @@ func Execute(cmd *cobra.Command, args []string) error {
 		sockURL, _ = url.Parse(redirectURL.Query().Get("socketUrl"))
 		shell, err = v1client.Dial(sockURL.String(), command, tty)
 		if err != nil {
-			return fmt.Errorf("could not create the shell client: %v", err)
+			return nil, fmt.Errorf("could not create the shell client: %v", err)
 		}
 	case "2":
 		sockURL, _ = url.Parse(redirectURL.Query().Get("socketUrl"))
 		shell, err = v2client.Dial(sockURL.String(), command, tty)
 		if err != nil {
-			return fmt.Errorf("could not create the shell client: %v", err)
+			return nil, fmt.Errorf("could not create the shell client: %v", err)
 		}
 	default:
-		return errors.New("unknown shell version")
-	}
-
-	// Switch terminal to raw mode
-	cleanup := func() {}
-	if tty {
-		cleanup = setupRawTerminal(shell.SetSize)
+		return nil, errors.New("unknown shell version")
 	}
 
-	// Connect pipes
-	go ioext.CopyAndClose(shell.StdinPipe(), os.Stdin)
-	go io.Copy(os.Stdout, shell.StdoutPipe())
-	go io.Copy(os.Stderr, shell.StderrPipe())
-
-	// Wait for shell to be done
-	_, err = shell.Wait()
-
-	// If we were in a tty we let's restore state
-	cleanup()
-
-	return err
+	return shell, nil
 }
 
-// checkTask makes sure that the given task is interactive and that we can connect.
-func checkTask(q *queue.Queue, taskID string) error {
+// checkTaskRun makes sure that the task is interactive and that the run
+// targeted by target (the last run, unless a specific runId was given) can
+// be connected to.
+func checkTaskRun(q *queue.Queue, target *shellTarget) error {
+	taskID := target.taskID
+
 	task, err := q.Task(taskID)
 	if err != nil {
 		return fmt.Errorf("could not get the definition of task %s: %v", taskID, err)
@@ -172,10 +337,19 @@ func checkTask(q *queue.Queue, taskID string) error {
 	if err != nil {
 		return fmt.Errorf("could not get the status of task %s: %v", taskID, err)
 	}
-	lastRunState := s.Status.Runs[len(s.Status.Runs)-1].State
-	lastRunDeadline := time.Time(s.Status.Runs[len(s.Status.Runs)-1].Resolved).Add(15 * time.Minute)
-	if !(lastRunState == "running" || (lastRunState == "completed" && lastRunDeadline.After(time.Now().UTC()))) {
-		return fmt.Errorf("task %s is not running and was not completed in the last 15 minutes", taskID)
+
+	runIndex := len(s.Status.Runs) - 1
+	if target.runID != nil {
+		runIndex = int(*target.runID)
+		if runIndex < 0 || runIndex >= len(s.Status.Runs) {
+			return fmt.Errorf("task %s has no run %d", taskID, *target.runID)
+		}
+	}
+
+	runState := s.Status.Runs[runIndex].State
+	runDeadline := time.Time(s.Status.Runs[runIndex].Resolved).Add(15 * time.Minute)
+	if !(runState == "running" || (runState == "completed" && runDeadline.After(time.Now().UTC()))) {
+		return fmt.Errorf("run %d of task %s is not running and was not completed in the last 15 minutes", runIndex, taskID)
 	}
 
 	return nil
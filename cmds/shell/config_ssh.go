@@ -0,0 +1,246 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	sshConfigBeginMarker = "# --- taskcluster shell ---"
+	sshConfigEndMarker   = "# --- end taskcluster shell ---"
+)
+
+var (
+	configSSHTaskID         string
+	configSSHAllInteractive bool
+	configSSHFile           string
+	configSSHDryRun         bool
+
+	configSSHCommand = &cobra.Command{
+		Use:   "config-ssh",
+		Short: "Write an SSH config entry so `ssh <taskId>` proxies through `taskcluster shell`.",
+		Long: `config-ssh generates (or refreshes) a managed block in an SSH config file
+that lets any SSH-speaking tool -- editors, rsync, VS Code Remote, ansible --
+reach an interactive task's shell, by pointing "ssh <taskId>" at
+"taskcluster shell <taskId> --stdio" as a ProxyCommand.
+
+Content outside the managed block is left untouched; re-running the command
+only rewrites the block between its markers.`,
+		RunE: executeConfigSSH,
+	}
+)
+
+func init() {
+	configSSHCommand.Flags().StringVar(&configSSHTaskID, "taskid", "", "generate an entry for this task only")
+	configSSHCommand.Flags().BoolVar(&configSSHAllInteractive, "all-interactive", false, "generate entries for every task remembered as interactive")
+	configSSHCommand.Flags().StringVar(&configSSHFile, "ssh-config-file", defaultSSHConfigFile(), "path to the SSH config file to update")
+	configSSHCommand.Flags().BoolVar(&configSSHDryRun, "dry-run", false, "print the resulting config instead of writing it")
+	Command.AddCommand(configSSHCommand)
+}
+
+func defaultSSHConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "config")
+}
+
+// executeConfigSSH writes or refreshes the managed taskcluster-shell block
+// in the user's SSH config.
+func executeConfigSSH(cmd *cobra.Command, args []string) error {
+	if configSSHTaskID == "" && !configSSHAllInteractive {
+		return fmt.Errorf("%s expects --taskid or --all-interactive", cmd.Name())
+	}
+	if configSSHFile == "" {
+		return errors.New("could not determine the default ssh config file, pass --ssh-config-file")
+	}
+
+	var taskIDs []string
+	if configSSHTaskID != "" {
+		if !taskIDPattern.MatchString(configSSHTaskID) {
+			return fmt.Errorf("invalid --taskid %q", configSSHTaskID)
+		}
+		taskIDs = append(taskIDs, configSSHTaskID)
+	}
+	if configSSHAllInteractive {
+		ids, err := knownInteractiveTasks()
+		if err != nil {
+			return fmt.Errorf("could not list interactive tasks: %v", err)
+		}
+		taskIDs = append(taskIDs, ids...)
+	}
+
+	block := renderSSHConfigBlock(taskIDs)
+
+	existing, err := ioutil.ReadFile(configSSHFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not read %s: %v", configSSHFile, err)
+	}
+
+	updated := spliceManagedBlock(string(existing), block)
+
+	if configSSHDryRun {
+		fmt.Print(updated)
+		return nil
+	}
+
+	return atomicWriteFile(configSSHFile, updated)
+}
+
+// renderSSHConfigBlock renders the managed block for the given task IDs.
+func renderSSHConfigBlock(taskIDs []string) string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "taskcluster"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, sshConfigBeginMarker)
+	for _, taskID := range taskIDs {
+		fmt.Fprintf(&buf, "Host %s\n", taskID)
+		fmt.Fprintf(&buf, "  ProxyCommand %s shell %s --stdio\n", quoteProxyCommandArg(exe), taskID)
+		fmt.Fprintln(&buf, "  StrictHostKeyChecking no")
+		fmt.Fprintln(&buf, "  UserKnownHostsFile /dev/null")
+	}
+	fmt.Fprintln(&buf, sshConfigEndMarker)
+	return buf.String()
+}
+
+// quoteProxyCommandArg quotes path for use inside an OpenSSH ProxyCommand.
+// On Windows this means wrapping it in double quotes; everywhere else a
+// single-quoted shell word works.
+func quoteProxyCommandArg(path string) string {
+	if !strings.ContainsAny(path, " \t") {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return `"` + path + `"`
+	}
+	return "'" + strings.Replace(path, "'", `'\''`, -1) + "'"
+}
+
+// spliceManagedBlock replaces the content between the markers in existing
+// with block, preserving everything else. If the markers are absent, block
+// is appended to the end of the file.
+func spliceManagedBlock(existing, block string) string {
+	lines := strings.Split(existing, "\n")
+	begin, end := -1, -1
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case sshConfigBeginMarker:
+			begin = i
+		case sshConfigEndMarker:
+			end = i
+		}
+	}
+
+	if begin == -1 || end == -1 || end < begin {
+		if existing != "" && !strings.HasSuffix(existing, "\n") {
+			existing += "\n"
+		}
+		return existing + block
+	}
+
+	before := strings.Join(lines[:begin], "\n")
+	after := strings.Join(lines[end+1:], "\n")
+	if before != "" && !strings.HasSuffix(before, "\n") {
+		before += "\n"
+	}
+	return before + strings.TrimSuffix(block, "\n") + "\n" + strings.TrimPrefix(after, "\n")
+}
+
+// atomicWriteFile writes data to path via a temporary file in the same
+// directory followed by a rename, so readers never observe a partially
+// written config.
+func atomicWriteFile(path, data string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("could not create %s: %v", dir, err)
+	}
+	tmp, err := ioutil.TempFile(dir, ".taskcluster-shell-config-*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write %s: %v", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not close %s: %v", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("could not set permissions on %s: %v", tmp.Name(), err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// rememberInteractiveTask appends taskID to the local interactive-task
+// cache used by `config-ssh --all-interactive`. Failures are not fatal:
+// this is a convenience cache, not a source of truth.
+func rememberInteractiveTask(taskID string) {
+	path := interactiveTaskCacheFile()
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+
+	ids, _ := knownInteractiveTasks()
+	for _, id := range ids {
+		if id == taskID {
+			return
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, taskID)
+}
+
+// knownInteractiveTasks returns the task IDs remembered in the local
+// interactive-task cache.
+func knownInteractiveTasks() ([]string, error) {
+	path := interactiveTaskCacheFile()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			ids = append(ids, line)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+func interactiveTaskCacheFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".taskcluster", "interactive-tasks")
+}
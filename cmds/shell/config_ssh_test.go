@@ -0,0 +1,60 @@
+package shell
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestQuoteProxyCommandArg(t *testing.T) {
+	if got, want := quoteProxyCommandArg("/usr/bin/taskcluster"), "/usr/bin/taskcluster"; got != want {
+		t.Errorf("quoteProxyCommandArg(no spaces) = %q, want %q", got, want)
+	}
+
+	got := quoteProxyCommandArg("/path with spaces/taskcluster")
+	if runtime.GOOS == "windows" {
+		if want := `"/path with spaces/taskcluster"`; got != want {
+			t.Errorf("quoteProxyCommandArg(spaces) = %q, want %q", got, want)
+		}
+		return
+	}
+	if want := `'/path with spaces/taskcluster'`; got != want {
+		t.Errorf("quoteProxyCommandArg(spaces) = %q, want %q", got, want)
+	}
+}
+
+func TestSpliceManagedBlockAppendsWhenMarkersAbsent(t *testing.T) {
+	existing := "Host example.com\n  User root\n"
+	block := sshConfigBeginMarker + "\nHost abc\n" + sshConfigEndMarker + "\n"
+
+	got := spliceManagedBlock(existing, block)
+
+	if !strings.HasPrefix(got, existing) {
+		t.Fatalf("spliceManagedBlock did not preserve existing content, got:\n%s", got)
+	}
+	if !strings.Contains(got, block) {
+		t.Fatalf("spliceManagedBlock did not append the block, got:\n%s", got)
+	}
+}
+
+func TestSpliceManagedBlockReplacesExistingBlockOnly(t *testing.T) {
+	existing := "Host keep-me\n  User root\n" +
+		sshConfigBeginMarker + "\n" +
+		"Host stale\n" +
+		sshConfigEndMarker + "\n" +
+		"Host also-keep-me\n  User root\n"
+
+	block := sshConfigBeginMarker + "\nHost fresh\n" + sshConfigEndMarker + "\n"
+
+	got := spliceManagedBlock(existing, block)
+
+	if !strings.Contains(got, "Host keep-me") || !strings.Contains(got, "Host also-keep-me") {
+		t.Fatalf("spliceManagedBlock dropped content outside the managed block, got:\n%s", got)
+	}
+	if strings.Contains(got, "Host stale") {
+		t.Fatalf("spliceManagedBlock kept stale content inside the managed block, got:\n%s", got)
+	}
+	if !strings.Contains(got, "Host fresh") {
+		t.Fatalf("spliceManagedBlock did not write the new block, got:\n%s", got)
+	}
+}
@@ -0,0 +1,159 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	isatty "github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/taskcluster/taskcluster-cli/config"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+var listEndpointsCommand = &cobra.Command{
+	Use:   "list-endpoints <taskId>",
+	Short: "List the interactive shell endpoints a task exposes.",
+	Long: `list-endpoints enumerates every artifact matching **/shell.html across
+all of a task's runs, printing each as a <taskId>.<endpoint>/<runId> target
+that can be passed straight to "taskcluster shell".`,
+	RunE: executeListEndpoints,
+}
+
+func init() {
+	Command.AddCommand(listEndpointsCommand)
+}
+
+// shellEndpoint is one interactive shell artifact found on a task run.
+type shellEndpoint struct {
+	endpoint string
+	runID    uint
+}
+
+func executeListEndpoints(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("%s expects argument <taskId>", cmd.Name())
+	}
+	taskID := args[0]
+
+	var creds *tcclient.Credentials
+	if config.Credentials != nil {
+		creds = config.Credentials.ToClientCredentials()
+	}
+	q := queue.New(creds)
+
+	s, err := q.Status(taskID)
+	if err != nil {
+		return fmt.Errorf("could not get the status of task %s: %v", taskID, err)
+	}
+
+	runIDs := make([]uint, len(s.Status.Runs))
+	for i := range s.Status.Runs {
+		runIDs[i] = uint(i)
+	}
+
+	endpoints, err := discoverEndpoints(q, taskID, runIDs)
+	if err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("task %s has no interactive shell endpoints", taskID)
+	}
+
+	for _, e := range endpoints {
+		fmt.Printf("%s.%s/%d\n", taskID, e.endpoint, e.runID)
+	}
+	return nil
+}
+
+// discoverEndpoints lists the interactive shell artifacts present on the
+// given runs of taskID.
+func discoverEndpoints(q *queue.Queue, taskID string, runIDs []uint) ([]shellEndpoint, error) {
+	var endpoints []shellEndpoint
+	for _, runID := range runIDs {
+		continuationToken := ""
+		for {
+			artifacts, err := q.ListArtifacts(taskID, strconv.FormatUint(uint64(runID), 10), continuationToken, "")
+			if err != nil {
+				return nil, fmt.Errorf("could not list artifacts of run %d of task %s: %v", runID, taskID, err)
+			}
+			for _, a := range artifacts.Artifacts {
+				if isShellEndpointArtifact(a.Name) {
+					endpoints = append(endpoints, shellEndpoint{endpoint: endpointFromArtifactName(a.Name), runID: runID})
+				}
+			}
+			if artifacts.ContinuationToken == "" {
+				break
+			}
+			continuationToken = artifacts.ContinuationToken
+		}
+	}
+	return endpoints, nil
+}
+
+// resolveDefaultEndpoint returns the endpoint to use when the user didn't
+// specify one, picking the only available endpoint or prompting/erroring
+// when there is more than one. Only an interactive choice also sets
+// target.runID, to the chosen endpoint's run.
+func resolveDefaultEndpoint(q *queue.Queue, target *shellTarget) (string, error) {
+	var runIDs []uint
+	if target.runID != nil {
+		runIDs = []uint{*target.runID}
+	} else {
+		s, err := q.Status(target.taskID)
+		if err != nil {
+			return "", fmt.Errorf("could not get the status of task %s: %v", target.taskID, err)
+		}
+		if len(s.Status.Runs) == 0 {
+			return "", fmt.Errorf("task %s has no runs", target.taskID)
+		}
+		runIDs = []uint{uint(len(s.Status.Runs) - 1)}
+	}
+
+	endpoints, err := discoverEndpoints(q, target.taskID, runIDs)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(endpoints) {
+	case 0:
+		return "", fmt.Errorf("task %s has no interactive shell endpoints, run `taskcluster shell list-endpoints %s`", target.taskID, target.taskID)
+	case 1:
+		// endpoints[0].runID only scoped the discovery query to the latest
+		// run; when the caller didn't ask for a specific run, leave
+		// target.runID nil so dial/reconnect keep tracking whatever run is
+		// latest instead of getting pinned to the one seen here.
+		return endpoints[0].endpoint, nil
+	}
+
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		names := make([]string, len(endpoints))
+		for i, e := range endpoints {
+			names[i] = fmt.Sprintf("%s.%s/%d", target.taskID, e.endpoint, e.runID)
+		}
+		return "", fmt.Errorf("task %s has multiple interactive shell endpoints, pick one: %s", target.taskID, strings.Join(names, ", "))
+	}
+
+	fmt.Fprintf(os.Stderr, "task %s has multiple interactive shell endpoints:\n", target.taskID)
+	for i, e := range endpoints {
+		fmt.Fprintf(os.Stderr, "  %d: %s.%s/%d\n", i+1, target.taskID, e.endpoint, e.runID)
+	}
+	fmt.Fprint(os.Stderr, "choose one: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("could not read endpoint choice: %v", err)
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 1 || choice > len(endpoints) {
+		return "", fmt.Errorf("invalid choice %q", strings.TrimSpace(line))
+	}
+
+	chosen := endpoints[choice-1]
+	target.runID = &chosen.runID
+	return chosen.endpoint, nil
+}
@@ -0,0 +1,64 @@
+package shell
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// reconnectBackoff implements a capped exponential backoff with an optional
+// overall time budget, used to pace reconnect attempts after the
+// interactive websocket drops.
+type reconnectBackoff struct {
+	min, max, maxElapsed time.Duration
+
+	started time.Time
+	wait    time.Duration
+}
+
+func newReconnectBackoff(min, max, maxElapsed time.Duration) *reconnectBackoff {
+	return &reconnectBackoff{min: min, max: max, maxElapsed: maxElapsed, wait: min}
+}
+
+// next returns how long to wait before the next reconnect attempt, or false
+// if the time budget has been exhausted and the caller should give up.
+func (b *reconnectBackoff) next() (time.Duration, bool) {
+	if b.started.IsZero() {
+		b.started = time.Now()
+	}
+	if b.maxElapsed > 0 && time.Since(b.started) > b.maxElapsed {
+		return 0, false
+	}
+
+	wait := b.wait
+	b.wait *= 2
+	if b.wait > b.max {
+		b.wait = b.max
+	}
+	return wait, true
+}
+
+// isReconnectableError reports whether err looks like a transient transport
+// failure (a dropped socket, a closed connection) rather than a protocol or
+// application-level failure that reconnecting wouldn't fix.
+func isReconnectableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	// Both the v1 (docker-exec-ws) and v2 (taskcluster-worker) shell clients
+	// wrap the underlying websocket close error without exporting a type we
+	// can type-assert on here, so fall back to matching its message.
+	if strings.Contains(err.Error(), "websocket") {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoffDoublesUntilCappedAtMax(t *testing.T) {
+	b := newReconnectBackoff(10*time.Millisecond, 35*time.Millisecond, 0)
+
+	wants := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 35 * time.Millisecond, 35 * time.Millisecond}
+	for i, want := range wants {
+		wait, ok := b.next()
+		if !ok {
+			t.Fatalf("next() #%d: ok = false, want true", i)
+		}
+		if wait != want {
+			t.Errorf("next() #%d = %s, want %s", i, wait, want)
+		}
+	}
+}
+
+func TestReconnectBackoffGivesUpAfterMaxElapsed(t *testing.T) {
+	b := newReconnectBackoff(10*time.Millisecond, 10*time.Millisecond, 20*time.Millisecond)
+
+	if _, ok := b.next(); !ok {
+		t.Fatalf("first next(): ok = false, want true")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := b.next(); ok {
+		t.Errorf("next() after maxElapsed: ok = true, want false")
+	}
+}
+
+func TestReconnectBackoffNeverGivesUpWhenMaxElapsedIsZero(t *testing.T) {
+	b := newReconnectBackoff(time.Millisecond, time.Millisecond, 0)
+
+	if _, ok := b.next(); !ok {
+		t.Fatalf("first next(): ok = false, want true")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := b.next(); !ok {
+		t.Errorf("next() with maxElapsed = 0: ok = false, want true (never give up)")
+	}
+}
+
+func TestIsReconnectableError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"EOF", io.EOF, true},
+		{"wrapped EOF", fmt.Errorf("read: %w", io.EOF), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"net.OpError", &net.OpError{Op: "read", Err: errors.New("connection reset")}, true},
+		{"websocket message", errors.New("websocket: close 1006 (abnormal closure)"), true},
+		{"unrelated error", errors.New("task no-task-id has no run 3"), false},
+	}
+
+	for _, c := range cases {
+		if got := isReconnectableError(c.err); got != c.want {
+			t.Errorf("isReconnectableError(%s) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// castRecorder writes an asciinema v2 (https://docs.asciinema.org/manual/asciicast/v2/)
+// cast file: a JSON header line followed by newline-delimited
+// [elapsed_seconds, kind, data] events.
+type castRecorder struct {
+	f     *os.File
+	enc   *json.Encoder
+	mu    sync.Mutex
+	start time.Time
+}
+
+// newCastRecorder creates path and writes the asciicast header.
+func newCastRecorder(path string, width, height int) (*castRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s: %v", path, err)
+	}
+
+	rec := &castRecorder{f: f, enc: json.NewEncoder(f), start: time.Now()}
+
+	header := map[string]interface{}{
+		"version":   2,
+		"width":     width,
+		"height":    height,
+		"timestamp": rec.start.Unix(),
+		"env": map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+	}
+	if err := rec.enc.Encode(header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not write asciicast header to %s: %v", path, err)
+	}
+
+	return rec, nil
+}
+
+// event appends an [elapsed, kind, data] line to the cast file.
+func (r *castRecorder) event(kind, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elapsed := time.Since(r.start).Seconds()
+	// Errors writing to the cast file are not fatal to the session itself.
+	_ = r.enc.Encode([]interface{}{elapsed, kind, data})
+}
+
+// resize records a terminal-resize ("r") event.
+func (r *castRecorder) resize(cols, rows int) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *castRecorder) Close() error {
+	return r.f.Close()
+}
+
+// recordingWriter tees everything written through it into a castRecorder
+// event of the given kind ("o" for stdout, "i" for stdin), in addition to
+// passing it on to the underlying writer. Buffered data is flushed whenever
+// a newline is seen or every flushInterval, whichever comes first, so
+// playback reads smoothly without an event per byte.
+//
+// A recordingWriter's periodic flush runs on its own goroutine, so callers
+// must Close it once the copy it backs is done (e.g. when the shell session
+// it belongs to ends) to stop that goroutine rather than leaking it,
+// something that matters across `shell`'s reconnect attempts, each of which
+// creates a fresh recordingWriter.
+type recordingWriter struct {
+	underlying io.Writer
+	rec        *castRecorder
+	kind       string
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+const flushInterval = 50 * time.Millisecond
+
+func newRecordingWriter(underlying io.Writer, rec *castRecorder, kind string) *recordingWriter {
+	w := &recordingWriter{underlying: underlying, rec: rec, kind: kind, done: make(chan struct{})}
+	go w.flushPeriodically()
+	return w
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.underlying.Write(p)
+	if n > 0 {
+		w.mu.Lock()
+		w.buf.Write(p[:n])
+		hasNewline := bytes.IndexByte(p[:n], '\n') >= 0
+		w.mu.Unlock()
+		if hasNewline {
+			w.flush()
+		}
+	}
+	return n, err
+}
+
+func (w *recordingWriter) flush() {
+	w.mu.Lock()
+	if w.buf.Len() == 0 {
+		w.mu.Unlock()
+		return
+	}
+	data := w.buf.String()
+	w.buf.Reset()
+	w.mu.Unlock()
+
+	w.rec.event(w.kind, data)
+}
+
+func (w *recordingWriter) flushPeriodically() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flush goroutine and flushes any buffered data
+// one last time. It is safe to call more than once.
+func (w *recordingWriter) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	w.flush()
+	return nil
+}
@@ -0,0 +1,129 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readCastEvents reads the events (skipping the header line) written to a
+// cast file at path.
+func readCastEvents(t *testing.T, path string) [][]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatalf("%s has no header line", path)
+	}
+
+	var events [][]interface{}
+	for scanner.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("could not parse event line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestRecordingWriterFlushesOnNewline(t *testing.T) {
+	rec, err := newCastRecorder(filepath.Join(t.TempDir(), "session.cast"), 80, 24)
+	if err != nil {
+		t.Fatalf("newCastRecorder: %v", err)
+	}
+	defer rec.Close()
+
+	w := newRecordingWriter(&bytes.Buffer{}, rec, "o")
+	defer w.Close()
+
+	if _, err := w.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	events := readCastEvents(t, rec.f.Name())
+	if len(events) != 1 {
+		t.Fatalf("got %d events after a newline write, want 1", len(events))
+	}
+	if data := events[0][2].(string); data != "hello\n" {
+		t.Errorf("event data = %q, want %q", data, "hello\n")
+	}
+}
+
+func TestRecordingWriterFlushesOnTimer(t *testing.T) {
+	rec, err := newCastRecorder(filepath.Join(t.TempDir(), "session.cast"), 80, 24)
+	if err != nil {
+		t.Fatalf("newCastRecorder: %v", err)
+	}
+	defer rec.Close()
+
+	w := newRecordingWriter(&bytes.Buffer{}, rec, "o")
+	defer w.Close()
+
+	if _, err := w.Write([]byte("no newline yet")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if events := readCastEvents(t, rec.f.Name()); len(events) != 0 {
+		t.Fatalf("got %d events before the flush interval elapsed, want 0", len(events))
+	}
+
+	time.Sleep(2 * flushInterval)
+
+	events := readCastEvents(t, rec.f.Name())
+	if len(events) != 1 {
+		t.Fatalf("got %d events after the flush interval elapsed, want 1", len(events))
+	}
+	if data := events[0][2].(string); data != "no newline yet" {
+		t.Errorf("event data = %q, want %q", data, "no newline yet")
+	}
+}
+
+func TestRecordingWriterCloseFlushesResidualData(t *testing.T) {
+	rec, err := newCastRecorder(filepath.Join(t.TempDir(), "session.cast"), 80, 24)
+	if err != nil {
+		t.Fatalf("newCastRecorder: %v", err)
+	}
+	defer rec.Close()
+
+	w := newRecordingWriter(&bytes.Buffer{}, rec, "o")
+
+	if _, err := w.Write([]byte("trailing, unflushed")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	events := readCastEvents(t, rec.f.Name())
+	if len(events) != 1 {
+		t.Fatalf("got %d events after Close, want 1", len(events))
+	}
+	if data := events[0][2].(string); data != "trailing, unflushed" {
+		t.Errorf("event data = %q, want %q", data, "trailing, unflushed")
+	}
+}
+
+func TestRecordingWriterCloseIsIdempotent(t *testing.T) {
+	rec, err := newCastRecorder(filepath.Join(t.TempDir(), "session.cast"), 80, 24)
+	if err != nil {
+		t.Fatalf("newCastRecorder: %v", err)
+	}
+	defer rec.Close()
+
+	w := newRecordingWriter(&bytes.Buffer{}, rec, "o")
+	if err := w.Close(); err != nil {
+		t.Fatalf("first Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
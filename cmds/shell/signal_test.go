@@ -0,0 +1,113 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// fakeShell is a minimal engines.Shell used to assert which frames
+// forwardInterrupt/closeShellStdin/resendWindowSize send, without needing a
+// real v1/v2 shell client.
+type fakeShell struct {
+	stdin      bytes.Buffer
+	stdinClose int
+
+	sizeColumns, sizeRows int
+	setSizeCalls          int
+}
+
+func (s *fakeShell) StdinPipe() io.WriteCloser { return &fakeWriteCloser{buf: &s.stdin, shell: s} }
+func (s *fakeShell) StdoutPipe() io.Reader     { return ioutil.NopCloser(&bytes.Buffer{}) }
+func (s *fakeShell) StderrPipe() io.Reader     { return ioutil.NopCloser(&bytes.Buffer{}) }
+func (s *fakeShell) Wait() (uint32, error)     { return 0, nil }
+
+func (s *fakeShell) SetSize(columns, rows int) error {
+	s.sizeColumns, s.sizeRows = columns, rows
+	s.setSizeCalls++
+	return nil
+}
+
+type fakeWriteCloser struct {
+	buf   *bytes.Buffer
+	shell *fakeShell
+}
+
+func (w *fakeWriteCloser) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *fakeWriteCloser) Close() error {
+	w.shell.stdinClose++
+	return nil
+}
+
+// fakeControlShell additionally implements signalSender and stdinCloser,
+// standing in for a shell client with a control channel.
+type fakeControlShell struct {
+	fakeShell
+	interruptCalls  int
+	closeStdinCalls int
+}
+
+func (s *fakeControlShell) SignalInterrupt() error {
+	s.interruptCalls++
+	return nil
+}
+
+func (s *fakeControlShell) CloseStdin() error {
+	s.closeStdinCalls++
+	s.stdinClose++
+	return nil
+}
+
+func TestForwardInterruptUsesControlChannelWhenAvailable(t *testing.T) {
+	s := &fakeControlShell{}
+	forwardInterrupt(s)
+
+	if s.interruptCalls != 1 {
+		t.Errorf("interruptCalls = %d, want 1", s.interruptCalls)
+	}
+	if s.stdin.Len() != 0 {
+		t.Errorf("stdin = %q, want empty (should not fall back to ^C byte)", s.stdin.String())
+	}
+}
+
+func TestForwardInterruptFallsBackToCtrlCByte(t *testing.T) {
+	s := &fakeShell{}
+	forwardInterrupt(s)
+
+	if got, want := s.stdin.String(), "\x03"; got != want {
+		t.Errorf("stdin = %q, want %q", got, want)
+	}
+}
+
+func TestCloseShellStdinUsesControlChannelWhenAvailable(t *testing.T) {
+	s := &fakeControlShell{}
+	closeShellStdin(s)
+
+	if s.closeStdinCalls != 1 {
+		t.Errorf("closeStdinCalls = %d, want 1", s.closeStdinCalls)
+	}
+	if s.stdinClose != 1 {
+		t.Errorf("stdinClose = %d, want 1", s.stdinClose)
+	}
+}
+
+func TestCloseShellStdinFallsBackToClosingThePipe(t *testing.T) {
+	s := &fakeShell{}
+	closeShellStdin(s)
+
+	if s.stdinClose != 1 {
+		t.Errorf("stdinClose = %d, want 1", s.stdinClose)
+	}
+}
+
+func TestResendWindowSizeNoopsWithoutATerminal(t *testing.T) {
+	// go test's stdout is not a terminal, so terminal.GetSize fails and
+	// resendWindowSize should do nothing rather than push a bogus size.
+	s := &fakeShell{}
+	resendWindowSize(s, nil)
+
+	if s.setSizeCalls != 0 {
+		t.Errorf("setSizeCalls = %d, want 0", s.setSizeCalls)
+	}
+}
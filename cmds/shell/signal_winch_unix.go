@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package shell
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyWinch wires ch up to SIGWINCH, the terminal-resize signal.
+func notifyWinch(ch chan os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
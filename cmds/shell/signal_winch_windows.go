@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package shell
+
+import "os"
+
+// notifyWinch is a no-op on Windows, which has no SIGWINCH: a console resize
+// after the session has started is not sent to the remote shell.
+func notifyWinch(ch chan os.Signal) {}
@@ -0,0 +1,209 @@
+package shell
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSSHOverStdio lets --stdio work as an OpenSSH ProxyCommand: conn
+// doesn't carry the remote shell's bytes directly (that's what the
+// non-stdio path in Execute does), it carries an SSH connection that OpenSSH itself is
+// driving. This runs a minimal single-session SSH server over conn and
+// bridges the session it opens to shell's pipes, so that by the time any
+// bytes reach shell, they have already been through the real SSH version
+// exchange and encryption `ssh` expects on the other end of its
+// ProxyCommand. In production conn is stdin/stdout wrapped by stdioConn;
+// tests pass a net.Pipe to drive a real ssh client against it directly.
+func serveSSHOverStdio(conn net.Conn, shell engines.Shell, rec *castRecorder) error {
+	signer, err := newEphemeralHostKey()
+	if err != nil {
+		return fmt.Errorf("could not generate a host key for --stdio: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		// The caller already authenticated to reach this point: dial()
+		// only got here via a queue-signed artifact URL scoped to one task.
+		// --stdio serves exactly one already-authorized local OpenSSH
+		// client, so no further authentication happens at the SSH layer.
+		NoClientAuth: true,
+	}
+	config.AddHostKey(signer)
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return fmt.Errorf("ssh handshake over --stdio failed: %v", err)
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	// A shell session opens exactly one channel; serve it and we're done.
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only a single \"session\" channel is supported over --stdio")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return fmt.Errorf("could not accept ssh session channel: %v", err)
+		}
+		return bridgeSessionChannel(channel, requests, shell, rec)
+	}
+	return nil
+}
+
+// ptyRequestMsg is the payload of a "pty-req" channel request, RFC 4254 §6.2.
+type ptyRequestMsg struct {
+	Term     string
+	Columns  uint32
+	Rows     uint32
+	Width    uint32
+	Height   uint32
+	Modelist string
+}
+
+// windowChangeMsg is the payload of a "window-change" channel request,
+// RFC 4254 §6.7.
+type windowChangeMsg struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+// bridgeSessionChannel acks the requests a real ssh client sends on a
+// session channel (pty-req, window-change, shell) and, once the client has
+// asked for a shell, copies bytes between channel and shell until one side
+// is done.
+func bridgeSessionChannel(channel ssh.Channel, requests <-chan *ssh.Request, shell engines.Shell, rec *castRecorder) error {
+	defer channel.Close()
+
+	shellRequested := make(chan struct{})
+	go func() {
+		for req := range requests {
+			ok := false
+			switch req.Type {
+			case "pty-req":
+				var msg ptyRequestMsg
+				if ssh.Unmarshal(req.Payload, &msg) == nil {
+					shell.SetSize(int(msg.Columns), int(msg.Rows))
+					if rec != nil {
+						rec.resize(int(msg.Columns), int(msg.Rows))
+					}
+				}
+				ok = true
+			case "window-change":
+				var msg windowChangeMsg
+				if ssh.Unmarshal(req.Payload, &msg) == nil {
+					shell.SetSize(int(msg.Columns), int(msg.Rows))
+					if rec != nil {
+						rec.resize(int(msg.Columns), int(msg.Rows))
+					}
+				}
+				ok = true
+			case "shell":
+				ok = true
+				close(shellRequested)
+			case "exec":
+				// The remote command is fixed at dial time, from the CLI's
+				// own <taskId> [-- command] argument, same as the non-stdio
+				// path; there is no way to redial with the command an
+				// "exec" request carries, so be explicit instead of
+				// silently ignoring it.
+			}
+			if req.WantReply {
+				req.Reply(ok, nil)
+			}
+		}
+	}()
+
+	select {
+	case <-shellRequested:
+	case <-time.After(shutdownGrace):
+		return fmt.Errorf("--stdio: ssh client never sent a shell request (a remote command via `ssh <taskId> -- cmd` is not supported over --stdio)")
+	}
+
+	stdout := io.Writer(channel)
+	stdin := io.Reader(channel)
+	var stdoutRec, stdinRec *recordingWriter
+	if rec != nil {
+		stdoutRec = newRecordingWriter(channel, rec, "o")
+		stdout = stdoutRec
+		if recordInput {
+			stdinRec = newRecordingWriter(ioutil.Discard, rec, "i")
+			stdin = io.TeeReader(channel, stdinRec)
+		}
+	}
+
+	go func() {
+		ioext.CopyAndClose(shell.StdinPipe(), stdin)
+		if stdinRec != nil {
+			stdinRec.Close()
+		}
+	}()
+	go func() {
+		io.Copy(stdout, shell.StdoutPipe())
+		if stdoutRec != nil {
+			stdoutRec.Close()
+		}
+	}()
+	go io.Copy(channel.Stderr(), shell.StderrPipe())
+
+	status, err := shell.Wait()
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	return err
+}
+
+// newEphemeralHostKey generates a fresh host key for a single --stdio
+// session. It only needs to live long enough for OpenSSH to complete its
+// handshake: `shell config-ssh` already writes `StrictHostKeyChecking no`
+// and `UserKnownHostsFile /dev/null` into the managed block, since there is
+// no stable key here to pin to across invocations.
+func newEphemeralHostKey() (ssh.Signer, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(priv)
+}
+
+// stdioConn adapts stdin/stdout to a net.Conn, so the SSH handshake has the
+// duplex byte stream it expects to run over, the way it would over a TCP
+// socket dialed by a normal ssh client.
+type stdioConn struct {
+	closeOnce sync.Once
+}
+
+func (c *stdioConn) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (c *stdioConn) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+
+func (c *stdioConn) Close() error {
+	c.closeOnce.Do(func() {
+		os.Stdin.Close()
+		os.Stdout.Close()
+	})
+	return nil
+}
+
+func (c *stdioConn) LocalAddr() net.Addr                { return stdioAddr{} }
+func (c *stdioConn) RemoteAddr() net.Addr               { return stdioAddr{} }
+func (c *stdioConn) SetDeadline(t time.Time) error      { return nil }
+func (c *stdioConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *stdioConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// stdioAddr is the net.Addr reported for stdioConn, which has no real
+// network endpoint.
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "stdio" }
@@ -0,0 +1,167 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// bridgeFakeShell is a controllable engines.Shell used to drive a real
+// golang.org/x/crypto/ssh client against serveSSHOverStdio/
+// bridgeSessionChannel, end to end, without needing a real v1/v2 shell
+// client or a real websocket server.
+type bridgeFakeShell struct {
+	stdinMu sync.Mutex
+	stdin   bytes.Buffer
+	stdout  io.Reader
+
+	setSizeCalls          int
+	sizeColumns, sizeRows int
+
+	done chan struct{}
+}
+
+func newBridgeFakeShell(stdout string) *bridgeFakeShell {
+	return &bridgeFakeShell{stdout: strings.NewReader(stdout), done: make(chan struct{})}
+}
+
+func (s *bridgeFakeShell) StdinPipe() io.WriteCloser { return &bridgeFakeShellStdin{s} }
+func (s *bridgeFakeShell) StdoutPipe() io.Reader     { return s.stdout }
+func (s *bridgeFakeShell) StderrPipe() io.Reader     { return ioutil.NopCloser(&bytes.Buffer{}) }
+func (s *bridgeFakeShell) Wait() (uint32, error) {
+	<-s.done
+	return 0, nil
+}
+
+func (s *bridgeFakeShell) SetSize(columns, rows int) error {
+	s.setSizeCalls++
+	s.sizeColumns, s.sizeRows = columns, rows
+	return nil
+}
+
+func (s *bridgeFakeShell) readStdin() string {
+	s.stdinMu.Lock()
+	defer s.stdinMu.Unlock()
+	return s.stdin.String()
+}
+
+type bridgeFakeShellStdin struct{ s *bridgeFakeShell }
+
+func (w *bridgeFakeShellStdin) Write(p []byte) (int, error) {
+	w.s.stdinMu.Lock()
+	defer w.s.stdinMu.Unlock()
+	return w.s.stdin.Write(p)
+}
+func (w *bridgeFakeShellStdin) Close() error { return nil }
+
+// dialTestSSHClient completes a real SSH handshake against serverConn,
+// the way OpenSSH would against our --stdio adapter.
+func dialTestSSHClient(t *testing.T, clientConn net.Conn) *ssh.Client {
+	t.Helper()
+	sshConn, chans, reqs, err := ssh.NewClientConn(clientConn, "stdio", &ssh.ClientConfig{
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("ssh client handshake against --stdio adapter failed: %v", err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs)
+}
+
+func TestServeSSHOverStdioBridgesShellSessionToShell(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	shell := newBridgeFakeShell("remote output\n")
+
+	serveErrCh := make(chan error, 1)
+	go func() { serveErrCh <- serveSSHOverStdio(serverConn, shell, nil) }()
+
+	client := dialTestSSHClient(t, clientConn)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatalf("RequestPty: %v", err)
+	}
+	if shell.setSizeCalls != 1 || shell.sizeColumns != 80 || shell.sizeRows != 24 {
+		t.Errorf("SetSize called with (%d, %d) x%d, want (80, 24) x1", shell.sizeColumns, shell.sizeRows, shell.setSizeCalls)
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatalf("StdinPipe: %v", err)
+	}
+
+	if err := session.Shell(); err != nil {
+		t.Fatalf("Shell: %v", err)
+	}
+
+	got := make([]byte, len("remote output\n"))
+	if _, err := io.ReadFull(stdout, got); err != nil {
+		t.Fatalf("reading bridged remote output: %v", err)
+	}
+	if string(got) != "remote output\n" {
+		t.Errorf("remote output = %q, want %q", got, "remote output\n")
+	}
+
+	if _, err := stdin.Write([]byte("local input\n")); err != nil {
+		t.Fatalf("writing bridged local input: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for shell.readStdin() != "local input\n" {
+		if time.Now().After(deadline) {
+			t.Fatalf("shell never received the bridged stdin, got %q", shell.readStdin())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(shell.done)
+	if err := <-serveErrCh; err != nil {
+		t.Errorf("serveSSHOverStdio returned %v, want nil", err)
+	}
+}
+
+func TestServeSSHOverStdioRejectsExecRequests(t *testing.T) {
+	savedShutdownGrace := shutdownGrace
+	shutdownGrace = 50 * time.Millisecond
+	defer func() { shutdownGrace = savedShutdownGrace }()
+
+	serverConn, clientConn := net.Pipe()
+	shell := newBridgeFakeShell("")
+
+	serveErrCh := make(chan error, 1)
+	go func() { serveErrCh <- serveSSHOverStdio(serverConn, shell, nil) }()
+
+	client := dialTestSSHClient(t, clientConn)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Run("ls"); err == nil {
+		t.Fatal("Run(\"ls\") succeeded, want an error: --stdio doesn't support a remote command via exec")
+	}
+
+	if err := <-serveErrCh; err == nil {
+		t.Error("serveSSHOverStdio returned nil, want an error after no shell request ever arrived")
+	}
+}
@@ -0,0 +1,92 @@
+package shell
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultEndpoint is the endpoint name used when none is given and the task
+// only exposes the stock docker-worker interactive shell.
+const defaultEndpoint = "docker-worker"
+
+// taskIDPattern matches the <taskId> portion of a shell target.
+var taskIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// runIDPattern matches a bare, fully-numeric /<runId> suffix.
+var runIDPattern = regexp.MustCompile(`^\d+$`)
+
+// shellTarget identifies a single interactive endpoint of a single run of a
+// task: which task, which artifact exposes the shell, and which run to pin
+// to (nil means "the latest run").
+type shellTarget struct {
+	taskID   string
+	endpoint string
+	runID    *uint
+}
+
+// parseShellTarget parses the <taskId>[.<endpoint>][/<runId>] grammar
+// accepted by `shell`.
+//
+// The run ID, when present, is always the text after the *last* slash, so
+// it can be told apart from an endpoint that itself contains slashes (e.g.
+// a raw artifact path like "private/docker-worker/shell.html").
+func parseShellTarget(arg string) (*shellTarget, error) {
+	rest := arg
+	target := &shellTarget{}
+
+	if idx := strings.LastIndex(rest, "/"); idx != -1 && runIDPattern.MatchString(rest[idx+1:]) {
+		runID, err := strconv.ParseUint(rest[idx+1:], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid runId in %q: %v", arg, err)
+		}
+		u := uint(runID)
+		target.runID = &u
+		rest = rest[:idx]
+	}
+
+	if idx := strings.Index(rest, "."); idx != -1 {
+		target.taskID = rest[:idx]
+		target.endpoint = rest[idx+1:]
+	} else {
+		target.taskID = rest
+	}
+
+	if target.taskID == "" || !taskIDPattern.MatchString(target.taskID) {
+		return nil, fmt.Errorf("invalid shell target %q, expected <taskId>[.<endpoint>][/<runId>]", arg)
+	}
+	return target, nil
+}
+
+// artifactName returns the artifact name that exposes the endpoint's shell,
+// e.g. "private/docker-worker/shell.html".
+func (t *shellTarget) artifactName() string {
+	endpoint := t.endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	if strings.Contains(endpoint, "/") || isShellEndpointArtifact(endpoint) {
+		return endpoint
+	}
+	return fmt.Sprintf("private/%s/shell.html", endpoint)
+}
+
+// isShellEndpointArtifact reports whether name is a candidate interactive
+// shell endpoint, i.e. it matches **/shell.html.
+func isShellEndpointArtifact(name string) bool {
+	return strings.HasSuffix(name, "/shell.html") || name == "shell.html"
+}
+
+// endpointFromArtifactName turns an artifact name back into the short
+// endpoint form accepted after the "." in a shell target.
+func endpointFromArtifactName(name string) string {
+	if strings.HasPrefix(name, "private/") && strings.HasSuffix(name, "/shell.html") {
+		short := strings.TrimSuffix(strings.TrimPrefix(name, "private/"), "/shell.html")
+		if short != "" && !strings.Contains(short, "/") {
+			return short
+		}
+	}
+	// Any other name is kept whole, which artifactName passes through as is.
+	return name
+}
@@ -0,0 +1,51 @@
+package shell
+
+import "testing"
+
+func TestParseShellTarget(t *testing.T) {
+	cases := []struct {
+		arg       string
+		taskID    string
+		endpoint  string
+		runID     *uint
+		expectErr bool
+	}{
+		{arg: "taskId", taskID: "taskId"},
+		{arg: "taskId/1", taskID: "taskId", runID: uintPtr(1)},
+		{arg: "taskId.ep", taskID: "taskId", endpoint: "ep"},
+		{arg: "taskId.ep/1", taskID: "taskId", endpoint: "ep", runID: uintPtr(1)},
+		{arg: "taskId.private/docker-worker/shell.html", taskID: "taskId", endpoint: "private/docker-worker/shell.html"},
+		{arg: "", expectErr: true},
+	}
+
+	for _, c := range cases {
+		target, err := parseShellTarget(c.arg)
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("parseShellTarget(%q): expected an error, got none", c.arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parseShellTarget(%q): unexpected error: %v", c.arg, err)
+		}
+		if target.taskID != c.taskID {
+			t.Errorf("parseShellTarget(%q): taskID = %q, want %q", c.arg, target.taskID, c.taskID)
+		}
+		if target.endpoint != c.endpoint {
+			t.Errorf("parseShellTarget(%q): endpoint = %q, want %q", c.arg, target.endpoint, c.endpoint)
+		}
+		switch {
+		case c.runID == nil && target.runID != nil:
+			t.Errorf("parseShellTarget(%q): runID = %d, want nil", c.arg, *target.runID)
+		case c.runID != nil && target.runID == nil:
+			t.Errorf("parseShellTarget(%q): runID = nil, want %d", c.arg, *c.runID)
+		case c.runID != nil && target.runID != nil && *c.runID != *target.runID:
+			t.Errorf("parseShellTarget(%q): runID = %d, want %d", c.arg, *target.runID, *c.runID)
+		}
+	}
+}
+
+func uintPtr(v uint) *uint {
+	return &v
+}